@@ -0,0 +1,49 @@
+// Command msxmml-watch recompiles an MML file and re-renders it through the
+// audio pipeline every time the file is saved, for an iterative
+// "save and hear" composing workflow.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/mariomac/msxmml/pkg/lang"
+	"github.com/mariomac/msxmml/pkg/solfege"
+	"github.com/mariomac/msxmml/pkg/watch"
+)
+
+func main() {
+	flag.Parse()
+	path := flag.Arg(0)
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "usage: msxmml-watch <file.mml>")
+		os.Exit(1)
+	}
+
+	player, err := solfege.NewPlayer()
+	if err != nil {
+		log.Fatalf("opening audio output: %s", err)
+	}
+	defer player.Close()
+
+	w, err := watch.New(path, player)
+	if err != nil {
+		log.Fatalf("watching %s: %s", path, err)
+	}
+	defer w.Close()
+
+	w.OnErrors = func(diags []lang.Diagnostic) {
+		sink := lang.DiagnosticSink{}
+		for _, d := range diags {
+			sink.Add(d)
+		}
+		sink.FormatDiagnostics(os.Stderr, path)
+	}
+
+	log.Printf("watching %s, edit and save to hear changes", path)
+	if err := w.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,249 @@
+// Package midi encodes a compiled song.Song as a Standard MIDI File (SMF
+// format 1), with one MIDI track per channel.
+package midi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/mariomac/msxmml/pkg/song"
+	"github.com/mariomac/msxmml/pkg/song/note"
+)
+
+// DefaultPPQN is the pulses-per-quarter-note resolution used when
+// Options.PPQN is left at its zero value.
+const DefaultPPQN = 480
+
+// Options configures the MIDI encoding.
+type Options struct {
+	// PPQN is the number of MIDI ticks per quarter note. Defaults to
+	// DefaultPPQN when zero.
+	PPQN int
+}
+
+// midi controller numbers used to approximate the ADSR envelope, since
+// General MIDI has no native attack/decay/sustain/release message.
+const (
+	ccAttack       = 73
+	ccDecay        = 75
+	ccRelease      = 72
+	ccNrpnLSB      = 98
+	ccNrpnMSB      = 99
+	ccDataEntryMSB = 6
+	ccDataEntryLSB = 38
+	// nrpnSustainLevel is the NRPN parameter number addressed for sustain
+	// level. General MIDI defines no standard NRPN for it, but synths with
+	// a programmable envelope commonly reserve low parameter numbers for
+	// one, so 0 is used as the vendor-defined slot.
+	nrpnSustainLevel = 0x0000
+)
+
+// pitchSemitone maps a note.Pitch to its semitone offset within an octave,
+// following the MSX-BASIC convention where the octave starts at C.
+var pitchSemitone = map[note.Pitch]int{
+	note.C: 0, note.D: 2, note.E: 4, note.F: 5,
+	note.G: 7, note.A: 9, note.B: 11,
+}
+
+// Encode consumes a compiled song.Song and writes it to w as a Standard
+// MIDI File. Each song.Channel becomes its own MIDI track, note lengths are
+// converted to ticks using opts.PPQN, AdsrVector envelopes become CC events
+// at the start of the track, and a LoopTag position is recorded as a
+// "loopStart" marker meta-event.
+func Encode(s *song.Song, w io.Writer, opts Options) error {
+	ppqn := opts.PPQN
+	if ppqn == 0 {
+		ppqn = DefaultPPQN
+	}
+
+	tracks := make([][]byte, 0, len(s.Channels))
+	for _, ch := range s.Channels {
+		track, err := encodeTrack(ch, ppqn)
+		if err != nil {
+			return fmt.Errorf("encoding channel %q: %w", ch.ID, err)
+		}
+		tracks = append(tracks, track)
+	}
+
+	if err := writeHeader(w, len(tracks), ppqn); err != nil {
+		return fmt.Errorf("writing MIDI header: %w", err)
+	}
+	for _, track := range tracks {
+		if err := writeChunk(w, "MTrk", track); err != nil {
+			return fmt.Errorf("writing track chunk: %w", err)
+		}
+	}
+	return nil
+}
+
+func writeHeader(w io.Writer, numTracks, ppqn int) error {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.BigEndian, uint16(1)) // SMF format 1
+	binary.Write(buf, binary.BigEndian, uint16(numTracks))
+	binary.Write(buf, binary.BigEndian, uint16(ppqn))
+	return writeChunk(w, "MThd", buf.Bytes())
+}
+
+func writeChunk(w io.Writer, id string, data []byte) error {
+	if _, err := io.WriteString(w, id); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// encodeTrack renders a single song.Channel into an MTrk event stream. A
+// Silence note has no MIDI event of its own, so its ticks accumulate in
+// pending and are folded into the delta-time of whatever event comes next
+// (a note-on, the loopStart marker, or the end-of-track meta-event),
+// instead of being written out as a standalone delta-time with nothing
+// after it.
+func encodeTrack(ch song.Channel, ppqn int) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	writeAdsr(buf, ch.Adsr)
+
+	pending := 0
+	loop := loopIndex(ch)
+	for i, ev := range ch.Notes {
+		ticks := noteTicks(ev, ppqn)
+		if loop >= 0 && loop == i {
+			writeMarker(buf, pending, "loopStart")
+			pending = 0
+		}
+		if ev.Note.Pitch == note.Silence {
+			pending += ticks
+			continue
+		}
+		key := midiKey(ev)
+		writeVLQ(buf, pending)
+		pending = 0
+		buf.WriteByte(0x90) // note-on, channel 0
+		buf.WriteByte(byte(key))
+		buf.WriteByte(0x64) // fixed velocity; the MML grammar has no velocity token
+		writeVLQ(buf, ticks)
+		buf.WriteByte(0x80) // note-off, channel 0
+		buf.WriteByte(byte(key))
+		buf.WriteByte(0x00)
+	}
+
+	writeVLQ(buf, pending)
+	buf.Write([]byte{0xFF, 0x2F, 0x00}) // end of track
+	return buf.Bytes(), nil
+}
+
+// noteTicks converts an MML note length (whole=1, half=2, quarter=4...),
+// honoring dots and an enclosing tuplet division, into MIDI ticks.
+func noteTicks(ev song.NoteEvent, ppqn int) int {
+	length := ev.Note.Length
+	if length == 0 {
+		length = 4
+	}
+	ticks := (4 * ppqn) / length
+	dotted := ticks
+	for i := 0; i < ev.Note.Dots; i++ {
+		dotted /= 2
+		ticks += dotted
+	}
+	if ev.Tuplet > 1 {
+		ticks /= ev.Tuplet
+	}
+	return ticks
+}
+
+// midiKey converts an absolute note.Note (pitch, halftone and octave) into
+// a MIDI key number, where MSX octave 4 matches MIDI octave 4 (middle C).
+func midiKey(ev song.NoteEvent) int {
+	key := 12 + ev.Note.Octave*12 + pitchSemitone[ev.Note.Pitch]
+	switch ev.Note.Halftone {
+	case note.Sharp:
+		key++
+	case note.Flat:
+		key--
+	}
+	return key
+}
+
+// loopIndex returns the Notes index where LoopTag was encountered, or -1 if
+// the channel has no loop point. It returns ch.LoopAt as is, so a channel
+// without a loop point must carry a LoopAt of -1: a LoopAt of 0 places the
+// loop point at the first note.
+func loopIndex(ch song.Channel) int {
+	return ch.LoopAt
+}
+
+func writeAdsr(buf *bytes.Buffer, adsr []song.TimePoint) {
+	if len(adsr) != 4 {
+		return
+	}
+	attack, decay, sustain, _ := adsr[0], adsr[1], adsr[2], adsr[3]
+
+	writeVLQ(buf, 0)
+	buf.Write([]byte{0xB0, ccAttack, byte(clamp7(int(attack.Time.Milliseconds())))})
+
+	writeVLQ(buf, 0)
+	buf.Write([]byte{0xB0, ccDecay, byte(clamp7(int(decay.Time.Milliseconds())))})
+
+	// sustain level has finer resolution than a single CC byte, so it goes
+	// out as an NRPN: CC99/98 select nrpnSustainLevel as the addressed
+	// parameter, then CC6/38 carry its 14-bit value as data entry MSB/LSB.
+	sustainLevel := clamp14(int(sustain.Val * 16383))
+	writeVLQ(buf, 0)
+	buf.Write([]byte{0xB0, ccNrpnMSB, byte((nrpnSustainLevel >> 7) & 0x7F)})
+	writeVLQ(buf, 0)
+	buf.Write([]byte{0xB0, ccNrpnLSB, byte(nrpnSustainLevel & 0x7F)})
+	writeVLQ(buf, 0)
+	buf.Write([]byte{0xB0, ccDataEntryMSB, byte((sustainLevel >> 7) & 0x7F)})
+	writeVLQ(buf, 0)
+	buf.Write([]byte{0xB0, ccDataEntryLSB, byte(sustainLevel & 0x7F)})
+
+	release := adsr[3]
+	writeVLQ(buf, 0)
+	buf.Write([]byte{0xB0, ccRelease, byte(clamp7(int(release.Time.Milliseconds())))})
+}
+
+func writeMarker(buf *bytes.Buffer, delta int, text string) {
+	writeVLQ(buf, delta)
+	buf.Write([]byte{0xFF, 0x06, byte(len(text))})
+	buf.WriteString(text)
+}
+
+// writeVLQ appends n encoded as a MIDI variable-length quantity.
+func writeVLQ(buf *bytes.Buffer, n int) {
+	var stack [5]byte
+	i := len(stack)
+	i--
+	stack[i] = byte(n & 0x7F)
+	n >>= 7
+	for n > 0 {
+		i--
+		stack[i] = byte(n&0x7F) | 0x80
+		n >>= 7
+	}
+	buf.Write(stack[i:])
+}
+
+func clamp7(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 127 {
+		return 127
+	}
+	return v
+}
+
+func clamp14(v int) int {
+	if v < 0 {
+		return 0
+	}
+	if v > 16383 {
+		return 16383
+	}
+	return v
+}
@@ -0,0 +1,185 @@
+package midi
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mariomac/msxmml/pkg/song"
+	"github.com/mariomac/msxmml/pkg/song/note"
+)
+
+func TestNoteTicks(t *testing.T) {
+	cases := []struct {
+		name string
+		ev   song.NoteEvent
+		want int
+	}{
+		{"quarter", song.NoteEvent{Note: note.Note{Length: 4}}, 480},
+		{"dotted quarter", song.NoteEvent{Note: note.Note{Length: 4, Dots: 1}}, 720},
+		{"eighth triplet", song.NoteEvent{Note: note.Note{Length: 8}, Tuplet: 3}, 80},
+		{"zero length defaults to quarter", song.NoteEvent{Note: note.Note{Length: 0}}, 480},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := noteTicks(c.ev, DefaultPPQN); got != c.want {
+				t.Errorf("noteTicks() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestMidiKey(t *testing.T) {
+	cases := []struct {
+		name string
+		ev   song.NoteEvent
+		want int
+	}{
+		{"middle C", song.NoteEvent{Note: note.Note{Pitch: note.C, Octave: 4}}, 60},
+		{"C sharp", song.NoteEvent{Note: note.Note{Pitch: note.C, Octave: 4, Halftone: note.Sharp}}, 61},
+		{"B flat", song.NoteEvent{Note: note.Note{Pitch: note.B, Octave: 4, Halftone: note.Flat}}, 70},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := midiKey(c.ev); got != c.want {
+				t.Errorf("midiKey() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestWriteVLQ(t *testing.T) {
+	cases := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7F}},
+		{128, []byte{0x81, 0x00}},
+		{480, []byte{0x83, 0x60}},
+	}
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		writeVLQ(buf, c.n)
+		if got := buf.Bytes(); !bytes.Equal(got, c.want) {
+			t.Errorf("writeVLQ(%d) = % X, want % X", c.n, got, c.want)
+		}
+	}
+}
+
+func TestClamp(t *testing.T) {
+	if clamp7(-1) != 0 || clamp7(200) != 127 || clamp7(64) != 64 {
+		t.Fatal("clamp7 didn't clamp to [0, 127]")
+	}
+	if clamp14(-1) != 0 || clamp14(20000) != 16383 || clamp14(100) != 100 {
+		t.Fatal("clamp14 didn't clamp to [0, 16383]")
+	}
+}
+
+// TestWriteAdsrSustainIsARealNRPN guards against the select/value roles
+// being swapped again: CC99/98 must carry the addressed parameter number,
+// and CC6/38 must carry the 14-bit sustain value.
+func TestWriteAdsrSustainIsARealNRPN(t *testing.T) {
+	buf := &bytes.Buffer{}
+	adsr := []song.TimePoint{
+		{Time: 10 * time.Millisecond},
+		{Time: 20 * time.Millisecond},
+		{Val: 1}, // full-scale sustain level
+		{Time: 30 * time.Millisecond},
+	}
+	writeAdsr(buf, adsr)
+
+	data := buf.Bytes()
+	if !bytes.Contains(data, []byte{0xB0, ccNrpnMSB, byte((nrpnSustainLevel >> 7) & 0x7F)}) {
+		t.Error("expected CC99 to select nrpnSustainLevel's MSB")
+	}
+	if !bytes.Contains(data, []byte{0xB0, ccNrpnLSB, byte(nrpnSustainLevel & 0x7F)}) {
+		t.Error("expected CC98 to select nrpnSustainLevel's LSB")
+	}
+	if !bytes.Contains(data, []byte{0xB0, ccDataEntryMSB, 0x7F}) {
+		t.Error("expected CC6 to carry the full-scale sustain level's data-entry MSB")
+	}
+}
+
+// TestEncodeTrackFoldsSilenceIntoNextEventDelta guards against a Silence
+// note being written as a standalone delta-time with no event after it,
+// which would desync every delta-time/status-byte pairing downstream of it.
+// A Silence's ticks must instead accumulate and surface as part of the
+// delta-time of whatever event comes next.
+func TestEncodeTrackFoldsSilenceIntoNextEventDelta(t *testing.T) {
+	ch := song.Channel{
+		LoopAt: -1,
+		Notes: []song.NoteEvent{
+			{Note: note.Note{Pitch: note.C, Octave: 4, Length: 4}},
+			{Note: note.Note{Pitch: note.Silence, Length: 4}},
+			{Note: note.Note{Pitch: note.D, Octave: 4, Length: 4}},
+		},
+	}
+
+	track, err := encodeTrack(ch, DefaultPPQN)
+	if err != nil {
+		t.Fatalf("encodeTrack returned error: %s", err)
+	}
+
+	restTicks := noteTicks(ch.Notes[1], DefaultPPQN)
+	dKey := midiKey(ch.Notes[2])
+
+	wantNoteOn := []byte{0x90, byte(midiKey(ch.Notes[0])), 0x64}
+	if !bytes.Contains(track, wantNoteOn) {
+		t.Fatalf("expected a note-on for the first note, got % X", track)
+	}
+
+	// The D note-on's delta-time must equal the rest's ticks, immediately
+	// followed by its note-on status byte and key - not a dangling VLQ.
+	wantDWithRestFolded := append(append([]byte{}, encodeVLQ(restTicks)...), 0x90, byte(dKey))
+	if !bytes.Contains(track, wantDWithRestFolded) {
+		t.Errorf("expected the rest's %d ticks folded into D's note-on delta-time, got % X", restTicks, track)
+	}
+}
+
+func encodeVLQ(n int) []byte {
+	buf := &bytes.Buffer{}
+	writeVLQ(buf, n)
+	return buf.Bytes()
+}
+
+// TestEncodeTrackSkipsLoopMarkerWhenUnlooped checks that a channel whose
+// LoopAt is -1, i.e. one never tagged with LOOP:, gets no loopStart marker.
+func TestEncodeTrackSkipsLoopMarkerWhenUnlooped(t *testing.T) {
+	ch := song.Channel{
+		LoopAt: -1,
+		Notes: []song.NoteEvent{
+			{Note: note.Note{Pitch: note.C, Octave: 4, Length: 4}},
+		},
+	}
+
+	track, err := encodeTrack(ch, DefaultPPQN)
+	if err != nil {
+		t.Fatalf("encodeTrack returned error: %s", err)
+	}
+	if bytes.Contains(track, []byte("loopStart")) {
+		t.Errorf("expected no loopStart marker on an unlooped channel, got % X", track)
+	}
+}
+
+func TestEncodeWritesOneTrackPerChannel(t *testing.T) {
+	s := &song.Song{
+		Channels: []song.Channel{
+			{ID: "A", Notes: []song.NoteEvent{{Note: note.Note{Pitch: note.C, Octave: 4, Length: 4}}}},
+			{ID: "B", Notes: []song.NoteEvent{{Note: note.Note{Pitch: note.Silence, Length: 4}}}},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := Encode(s, &out, Options{}); err != nil {
+		t.Fatalf("Encode returned error: %s", err)
+	}
+
+	got := out.Bytes()
+	if !bytes.HasPrefix(got, []byte("MThd")) {
+		t.Fatal("expected output to start with an MThd chunk")
+	}
+	if n := bytes.Count(got, []byte("MTrk")); n != len(s.Channels) {
+		t.Errorf("expected %d MTrk chunks, got %d", len(s.Channels), n)
+	}
+}
@@ -0,0 +1,276 @@
+// Package vgm encodes a compiled song.Song as a VGM 1.71 file targeting the
+// AY-3-8910/YM2149 PSG or the Konami SCC, the chiptune chips the MML
+// grammar's note/octave/ADSR vocabulary is aimed at.
+package vgm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/mariomac/msxmml/pkg/song"
+	"github.com/mariomac/msxmml/pkg/song/note"
+)
+
+// Chip selects the target sound chip for the VGM register writes.
+type Chip int
+
+const (
+	ChipAY Chip = iota
+	ChipSCC
+)
+
+// SampleRate is the VGM fixed sample rate (44100 Hz) used to convert note
+// durations into wait-sample counts.
+const SampleRate = 44100
+
+// Options configures the VGM encoding.
+type Options struct {
+	Chip Chip
+	// ClockHz is the emulated chip clock, e.g. 1789772 for the MSX's
+	// AY-3-8910. Defaults to DefaultClockHz when zero.
+	ClockHz uint32
+}
+
+// DefaultClockHz is the PSG clock used when Options.ClockHz is left at its
+// zero value, matching the MSX's stock AY-3-8910/YM2149.
+const DefaultClockHz = 1789772
+
+const (
+	headerSize  = 0x100
+	cmdAYWrite  = 0xA0
+	cmdSCCWrite = 0xD2
+	cmdWait     = 0x61
+	cmdEnd      = 0x66
+)
+
+// ayEnvelopeShape is the AY-3-8910 envelope shape that most closely
+// resembles a one-shot attack/decay/sustain/release contour: a single
+// decay ramp that then holds at zero.
+const ayEnvelopeShape = 0x09
+
+// channelEvent is one channel's note, timestamped at its absolute sample
+// offset from the start of the song, so events from different channels can
+// be merged into a single chronological VGM command stream.
+type channelEvent struct {
+	reg      int
+	start    int
+	duration int
+	period   int
+	silent   bool
+	loop     bool
+}
+
+// Encode consumes a compiled song.Song and writes it to w as a VGM 1.71
+// file. Every channel's notes become register writes for opts.Chip; since
+// VGM has no per-track concept, events from all channels are merged into a
+// single chronological stream before the wait commands that separate them
+// are emitted, so channels sound together rather than one after another.
+// For ChipAY, each channel's AdsrVector is mapped onto the envelope shape
+// and period registers; for ChipSCC no envelope is written. The sample
+// position where LoopTag appeared is recorded in the VGM loop offset field.
+func Encode(s *song.Song, w io.Writer, opts Options) error {
+	clock := opts.ClockHz
+	if clock == 0 {
+		clock = DefaultClockHz
+	}
+
+	data := &bytes.Buffer{}
+
+	var events []channelEvent
+	chanEnd := make([]int, len(s.Channels))
+	for chanIdx, ch := range s.Channels {
+		reg := chanIdx % 3 // AY/SCC both expose 3 usable tone channels for this grammar
+		writeAdsr(data, opts.Chip, reg, ch.Adsr)
+
+		t := 0
+		for i, ev := range ch.Notes {
+			samples := noteSamples(ev, clock)
+			events = append(events, channelEvent{
+				reg:      reg,
+				start:    t,
+				duration: samples,
+				period:   tonePeriod(ev, clock),
+				silent:   ev.Note.Pitch == note.Silence,
+				// ch.LoopAt is -1 on an unlooped channel, which matches no
+				// note index; a LoopAt of 0 marks the first note.
+				loop: ch.LoopAt >= 0 && i == ch.LoopAt,
+			})
+			t += samples
+		}
+		chanEnd[chanIdx] = t
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].start < events[j].start })
+
+	loopOffset := -1
+	cursor := 0
+	for _, ev := range events {
+		if ev.start > cursor {
+			writeWait(data, ev.start-cursor)
+			cursor = ev.start
+		}
+		if ev.loop && loopOffset < 0 {
+			loopOffset = data.Len()
+		}
+		if !ev.silent {
+			writeToneWrite(data, opts.Chip, ev.reg, ev.period)
+		}
+	}
+
+	totalSamples := 0
+	for _, end := range chanEnd {
+		if end > totalSamples {
+			totalSamples = end
+		}
+	}
+	if totalSamples > cursor {
+		writeWait(data, totalSamples-cursor)
+	}
+	data.WriteByte(cmdEnd)
+
+	header, err := buildHeader(clock, opts.Chip, data.Len(), uint32(totalSamples), loopOffset, uint32(totalSamples))
+	if err != nil {
+		return fmt.Errorf("building VGM header: %w", err)
+	}
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("writing VGM header: %w", err)
+	}
+	if _, err := w.Write(data.Bytes()); err != nil {
+		return fmt.Errorf("writing VGM data: %w", err)
+	}
+	return nil
+}
+
+func buildHeader(clock uint32, chip Chip, dataLen int, totalSamples uint32, loopOffset int, loopSamples uint32) ([]byte, error) {
+	h := make([]byte, headerSize)
+	copy(h[0:4], "Vgm ")
+	binary.LittleEndian.PutUint32(h[0x04:], uint32(headerSize+dataLen-0x04)) // eof offset, relative to itself
+	binary.LittleEndian.PutUint32(h[0x08:], 0x00000171)                      // version 1.71
+	binary.LittleEndian.PutUint32(h[0x18:], totalSamples)
+	if loopOffset >= 0 {
+		binary.LittleEndian.PutUint32(h[0x1C:], uint32(headerSize+loopOffset-0x1C))
+		binary.LittleEndian.PutUint32(h[0x20:], loopSamples)
+	}
+	switch chip {
+	case ChipAY:
+		binary.LittleEndian.PutUint32(h[0x74:], clock|0x80000000) // bit 31: dual-chip off, clock set
+	case ChipSCC:
+		binary.LittleEndian.PutUint32(h[0x90:], clock) // vendor extension offset used for SCC clock
+	default:
+		return nil, fmt.Errorf("unsupported chip %d", chip)
+	}
+	binary.LittleEndian.PutUint32(h[0x34:], uint32(headerSize-0x34)) // VGM data offset, relative to itself
+	return h, nil
+}
+
+// noteSamples converts an MML note length (whole=1, half=2, quarter=4...),
+// honoring dots and an enclosing tuplet division, into a wait-sample count
+// at the VGM's fixed 44100 Hz sample rate. It assumes a 120 BPM tempo,
+// consistent with the solfege rendering pipeline's default.
+func noteSamples(ev song.NoteEvent, clock uint32) int {
+	const beatsPerMinute = 120
+	length := ev.Note.Length
+	if length == 0 {
+		length = 4
+	}
+	wholeNoteSamples := (SampleRate * 60 * 4) / beatsPerMinute
+	samples := wholeNoteSamples / length
+	dotted := samples
+	for i := 0; i < ev.Note.Dots; i++ {
+		dotted /= 2
+		samples += dotted
+	}
+	if ev.Tuplet > 1 {
+		samples /= ev.Tuplet
+	}
+	return samples
+}
+
+var pitchSemitone = map[note.Pitch]int{
+	note.C: 0, note.D: 2, note.E: 4, note.F: 5,
+	note.G: 7, note.A: 9, note.B: 11,
+}
+
+// tonePeriod converts an absolute note.Note into the 12-bit tone period
+// the AY-3-8910/SCC expect, derived from the chip clock and the note's
+// frequency.
+func tonePeriod(ev song.NoteEvent, clock uint32) int {
+	semitone := 12*ev.Note.Octave + pitchSemitone[ev.Note.Pitch]
+	switch ev.Note.Halftone {
+	case note.Sharp:
+		semitone++
+	case note.Flat:
+		semitone--
+	}
+	freq := 440.0 * math.Exp2((float64(semitone)-57)/12.0)
+	period := int(float64(clock) / (16.0 * freq))
+	if period < 1 {
+		period = 1
+	}
+	if period > 0xFFF {
+		period = 0xFFF
+	}
+	return period
+}
+
+func writeToneWrite(buf *bytes.Buffer, chip Chip, ch int, period int) {
+	lo := byte(period & 0xFF)
+	hi := byte((period >> 8) & 0x0F)
+	switch chip {
+	case ChipAY:
+		buf.WriteByte(cmdAYWrite)
+		buf.WriteByte(byte(2 * ch))
+		buf.WriteByte(lo)
+		buf.WriteByte(cmdAYWrite)
+		buf.WriteByte(byte(2*ch + 1))
+		buf.WriteByte(hi)
+	case ChipSCC:
+		buf.WriteByte(cmdSCCWrite)
+		buf.WriteByte(0x00)
+		buf.WriteByte(byte(2 * ch))
+		buf.WriteByte(lo)
+		buf.WriteByte(cmdSCCWrite)
+		buf.WriteByte(0x00)
+		buf.WriteByte(byte(2*ch + 1))
+		buf.WriteByte(hi)
+	}
+}
+
+// writeAdsr maps an AdsrVector onto the AY-3-8910 envelope shape register
+// (R13) plus the period registers (R11/R12), the chip's only
+// envelope-shaping hardware. For the SCC, which has no envelope registers,
+// it writes nothing.
+func writeAdsr(buf *bytes.Buffer, chip Chip, ch int, adsr []song.TimePoint) {
+	if len(adsr) != 4 || chip != ChipAY {
+		return
+	}
+	attack, release := adsr[0], adsr[3]
+	envPeriod := int(attack.Time.Milliseconds()+release.Time.Milliseconds()) * 8
+	if envPeriod > 0xFFFF {
+		envPeriod = 0xFFFF
+	}
+	buf.WriteByte(cmdAYWrite)
+	buf.WriteByte(0x0B) // envelope period fine
+	buf.WriteByte(byte(envPeriod & 0xFF))
+	buf.WriteByte(cmdAYWrite)
+	buf.WriteByte(0x0C) // envelope period coarse
+	buf.WriteByte(byte((envPeriod >> 8) & 0xFF))
+	buf.WriteByte(cmdAYWrite)
+	buf.WriteByte(0x0D) // envelope shape
+	buf.WriteByte(ayEnvelopeShape)
+}
+
+func writeWait(buf *bytes.Buffer, samples int) {
+	for samples > 0xFFFF {
+		buf.WriteByte(cmdWait)
+		binary.Write(buf, binary.LittleEndian, uint16(0xFFFF))
+		samples -= 0xFFFF
+	}
+	if samples > 0 {
+		buf.WriteByte(cmdWait)
+		binary.Write(buf, binary.LittleEndian, uint16(samples))
+	}
+}
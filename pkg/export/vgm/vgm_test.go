@@ -0,0 +1,149 @@
+package vgm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/mariomac/msxmml/pkg/song"
+	"github.com/mariomac/msxmml/pkg/song/note"
+)
+
+func TestNoteSamples(t *testing.T) {
+	cases := []struct {
+		name string
+		ev   song.NoteEvent
+		want int
+	}{
+		{"quarter at 120bpm", song.NoteEvent{Note: note.Note{Length: 4}}, SampleRate / 2},
+		{"zero length defaults to quarter", song.NoteEvent{Note: note.Note{Length: 0}}, SampleRate / 2},
+		{"dotted quarter", song.NoteEvent{Note: note.Note{Length: 4, Dots: 1}}, SampleRate / 2 * 3 / 2},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := noteSamples(c.ev, DefaultClockHz); got != c.want {
+				t.Errorf("noteSamples() = %d, want %d", got, c.want)
+			}
+		})
+	}
+}
+
+func TestTonePeriodClampsToTwelveBits(t *testing.T) {
+	// An implausibly low note yields a period above the AY/SCC's 12-bit
+	// register width and must be clamped rather than truncated silently.
+	ev := song.NoteEvent{Note: note.Note{Pitch: note.C, Octave: 0}}
+	if got := tonePeriod(ev, DefaultClockHz); got != 0xFFF {
+		t.Errorf("tonePeriod() = %#x, want clamped %#x", got, 0xFFF)
+	}
+}
+
+// TestTonePeriodMatchesEqualTemperament guards against a hand-rolled
+// power-of-two approximation drifting away from equal temperament: A5, one
+// octave above the 440 Hz concert pitch A4, must land on exactly 880 Hz.
+func TestTonePeriodMatchesEqualTemperament(t *testing.T) {
+	ev := song.NoteEvent{Note: note.Note{Pitch: note.A, Octave: 5}}
+	want := int(float64(DefaultClockHz) / (16.0 * 880.0))
+	if got := tonePeriod(ev, DefaultClockHz); got != want {
+		t.Errorf("tonePeriod(A5) = %d, want %d (880 Hz)", got, want)
+	}
+}
+
+func TestWriteWaitSplitsOversizedWaits(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writeWait(buf, 0x10000)
+
+	got := buf.Bytes()
+	want := []byte{cmdWait, 0xFF, 0xFF, cmdWait, 0x01, 0x00}
+	if !bytes.Equal(got, want) {
+		t.Errorf("writeWait(0x10000) = % X, want % X", got, want)
+	}
+}
+
+type vgmOp int
+
+const (
+	opWrite vgmOp = iota
+	opWait
+	opEnd
+)
+
+// decodeOps reduces the raw VGM command stream after the header to its
+// opcode shape, ignoring operand bytes, so tests can assert on command
+// ordering without hand-computing tone periods.
+func decodeOps(data []byte) []vgmOp {
+	var ops []vgmOp
+	for i := 0; i < len(data); {
+		switch data[i] {
+		case cmdAYWrite:
+			ops = append(ops, opWrite)
+			i += 3
+		case cmdWait:
+			ops = append(ops, opWait)
+			i += 3
+		case cmdEnd:
+			ops = append(ops, opEnd)
+			i++
+		default:
+			i++
+		}
+	}
+	return ops
+}
+
+// TestEncodeLeavesLoopOffsetUnsetWhenUnlooped checks that a channel whose
+// LoopAt is -1, i.e. one never tagged with LOOP:, leaves the VGM header's
+// loop offset field at 0.
+func TestEncodeLeavesLoopOffsetUnsetWhenUnlooped(t *testing.T) {
+	quarter := song.NoteEvent{Note: note.Note{Pitch: note.C, Octave: 4, Length: 4}}
+	s := &song.Song{
+		Channels: []song.Channel{
+			{LoopAt: -1, Notes: []song.NoteEvent{quarter}},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := Encode(s, &out, Options{Chip: ChipAY}); err != nil {
+		t.Fatalf("Encode returned error: %s", err)
+	}
+
+	header := out.Bytes()[:headerSize]
+	if offset := binary.LittleEndian.Uint32(header[0x1C:]); offset != 0 {
+		t.Errorf("expected loop offset field to stay 0 for an unlooped channel, got %#x", offset)
+	}
+}
+
+// TestEncodeInterleavesChannelsChronologically guards against Encode
+// regressing into serializing each channel's notes back to back: two
+// channels sounding at the same instant must both get their tone writes
+// before the wait that advances past that instant, not one channel's full
+// stream followed by the other's.
+func TestEncodeInterleavesChannelsChronologically(t *testing.T) {
+	quarter := song.NoteEvent{Note: note.Note{Pitch: note.C, Octave: 4, Length: 4}}
+	half := song.NoteEvent{Note: note.Note{Pitch: note.C, Octave: 4, Length: 2}}
+
+	s := &song.Song{
+		Channels: []song.Channel{
+			{Notes: []song.NoteEvent{quarter, quarter}}, // two quarters: one at t=0, one at t=q
+			{Notes: []song.NoteEvent{half}},             // one half, same total span, starting at t=0
+		},
+	}
+
+	var out bytes.Buffer
+	if err := Encode(s, &out, Options{Chip: ChipAY}); err != nil {
+		t.Fatalf("Encode returned error: %s", err)
+	}
+
+	body := out.Bytes()[headerSize:]
+	got := decodeOps(body)
+	// write,write (chan0 tone) + write,write (chan1 tone, same t=0) then
+	// wait to t=q, write,write (chan0's second note), wait to the end, end.
+	want := []vgmOp{opWrite, opWrite, opWrite, opWrite, opWait, opWrite, opWrite, opWait, opEnd}
+	if len(got) != len(want) {
+		t.Fatalf("got %d ops %v, want %d ops %v", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("op %d = %v, want %v (full sequence %v)", i, got[i], want[i], got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package lang
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Severity classifies how serious a Diagnostic is.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Position is a row/column location in the source, both 1-based.
+type Position struct {
+	Row, Col int
+}
+
+// Diagnostic describes a problem found while tokenizing or parsing a source
+// file, together with enough context to render a caret pointing at it.
+type Diagnostic struct {
+	Severity   Severity
+	Message    string
+	Start, End Position
+	// Line is the full source line the diagnostic refers to, used for
+	// caret rendering in FormatDiagnostics.
+	Line string
+}
+
+// DiagnosticSink accumulates Diagnostics produced while processing a source
+// file, instead of aborting processing on the first problem found.
+type DiagnosticSink struct {
+	diagnostics []Diagnostic
+}
+
+// Add appends a Diagnostic to the sink.
+func (s *DiagnosticSink) Add(d Diagnostic) {
+	s.diagnostics = append(s.diagnostics, d)
+}
+
+// Errorf builds and appends an error-severity Diagnostic.
+func (s *DiagnosticSink) Errorf(start, end Position, line, format string, args ...any) {
+	s.Add(Diagnostic{
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, args...),
+		Start:    start,
+		End:      end,
+		Line:     line,
+	})
+}
+
+// Diagnostics returns all the Diagnostics accumulated so far.
+func (s *DiagnosticSink) Diagnostics() []Diagnostic {
+	return s.diagnostics
+}
+
+// HasErrors reports whether any error-severity Diagnostic was recorded.
+func (s *DiagnosticSink) HasErrors() bool {
+	return HasErrors(s.diagnostics)
+}
+
+// HasErrors reports whether diags contains at least one error-severity
+// Diagnostic, ignoring warnings. Callers that only want to abort on hard
+// errors (e.g. a batch compile or a watch-and-reload loop) should gate on
+// this instead of on len(diags) > 0.
+func HasErrors(diags []Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatDiagnostics prints all the sink's Diagnostics to w in GCC-style
+// "file:row:col: severity: message" form, followed by the offending source
+// line and a caret underline spanning Start to End.
+func (s *DiagnosticSink) FormatDiagnostics(w io.Writer, file string) error {
+	for _, d := range s.diagnostics {
+		if _, err := fmt.Fprintf(w, "%s:%d:%d: %s: %s\n", file, d.Start.Row, d.Start.Col, d.Severity, d.Message); err != nil {
+			return err
+		}
+		if d.Line == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", d.Line); err != nil {
+			return err
+		}
+		width := d.End.Col - d.Start.Col
+		if width < 1 {
+			width = 1
+		}
+		if _, err := fmt.Fprintf(w, "%s%s\n", strings.Repeat(" ", d.Start.Col-1), strings.Repeat("^", width)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatDiagnostics(t *testing.T) {
+	sink := DiagnosticSink{}
+	sink.Errorf(Position{Row: 2, Col: 5}, Position{Row: 2, Col: 8}, "c9999 d4", "wrong note length: 9999")
+
+	var out strings.Builder
+	if err := sink.FormatDiagnostics(&out, "song.mml"); err != nil {
+		t.Fatalf("FormatDiagnostics returned error: %s", err)
+	}
+
+	got := out.String()
+	wantLines := []string{
+		"song.mml:2:5: error: wrong note length: 9999",
+		"c9999 d4",
+		"    ^^^",
+	}
+	for _, want := range wantLines {
+		if !strings.Contains(got, want) {
+			t.Errorf("FormatDiagnostics output missing %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestDiagnosticSinkHasErrors(t *testing.T) {
+	sink := DiagnosticSink{}
+	if sink.HasErrors() {
+		t.Fatal("empty sink should not report errors")
+	}
+
+	sink.Add(Diagnostic{Severity: SeverityWarning, Message: "just a warning"})
+	if sink.HasErrors() {
+		t.Fatal("sink with only a warning should not report errors")
+	}
+
+	sink.Add(Diagnostic{Severity: SeverityError, Message: "boom"})
+	if !sink.HasErrors() {
+		t.Fatal("sink with an error-severity diagnostic should report errors")
+	}
+}
+
+func TestTokenizerErrorsOnOversizedNumber(t *testing.T) {
+	tok := NewTokenizer(strings.NewReader("c99999999999999999999\n"))
+	for tok.Next() {
+		tk := tok.Get()
+		if tk.Type == Note {
+			if _, err := tk.getNote(); err == nil {
+				t.Fatal("expected an error for an out-of-range note length")
+			}
+		}
+	}
+
+	if !HasErrors(tok.Errors()) {
+		t.Fatal("expected Tokenizer.Errors() to report the oversized number")
+	}
+}
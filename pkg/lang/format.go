@@ -0,0 +1,184 @@
+package lang
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FormatOptions controls how Format re-renders a token stream.
+type FormatOptions struct {
+	// LowercaseKeywords emits the LoopTag and AdsrVector keywords in lower
+	// case ("loop:"/"adsr:") instead of the canonical upper case form
+	// ("LOOP:"/"ADSR:").
+	LowercaseKeywords bool
+}
+
+// Format re-emits tokens as canonical MML text, fixing whitespace and the
+// capitalization of LoopTag/AdsrVector keywords, so that editor plugins and
+// `gofmt`-style tooling share the exact lexer the compiler uses rather than
+// reimplementing its regexes. A newline is emitted after every ChannelSync
+// token, keeping one measure per line, and the n-th Separator bar on each
+// line is column-aligned with the n-th Separator bar on every other line,
+// so parallel channel tracks read like a tracker's tab notation.
+func Format(tokens []Token, w io.Writer, opts FormatOptions) error {
+	lines := splitFormatLines(tokens, opts)
+
+	// target[n] is the widest column at which the n-th Separator on any
+	// line lands, using single-space joins once the Separators before it
+	// have been padded to their own targets. Padding an earlier Separator
+	// shifts every later one, so targets are settled group by group.
+	target := map[int]int{}
+	for g := 0; ; g++ {
+		found := false
+		for _, line := range lines {
+			col, group := 0, 0
+			for j, t := range line.tokens {
+				if j > 0 {
+					col++
+				}
+				if t.Type == Separator {
+					if group == g {
+						found = true
+						if col > target[g] {
+							target[g] = col
+						}
+						break
+					}
+					if pad := target[group] - col; pad > 0 {
+						col += pad
+					}
+					group++
+				}
+				col += len(line.texts[j])
+			}
+		}
+		if !found {
+			break
+		}
+	}
+
+	for _, line := range lines {
+		col, group := 0, 0
+		for j, t := range line.tokens {
+			if j > 0 {
+				col++
+				if _, err := io.WriteString(w, " "); err != nil {
+					return err
+				}
+			}
+			if t.Type == Separator {
+				if pad := target[group] - col; pad > 0 {
+					if _, err := io.WriteString(w, strings.Repeat(" ", pad)); err != nil {
+						return err
+					}
+					col += pad
+				}
+				group++
+			}
+			if _, err := io.WriteString(w, line.texts[j]); err != nil {
+				return err
+			}
+			col += len(line.texts[j])
+		}
+		if line.endsInSync {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatLine is one ChannelSync-delimited measure, with each token's
+// canonicalText precomputed so the alignment pass and the writing pass
+// don't render it twice.
+type formatLine struct {
+	tokens     []Token
+	texts      []string
+	endsInSync bool
+}
+
+// splitFormatLines groups tokens into lines, each ending at (and including)
+// a ChannelSync token, with any trailing tokens after the last ChannelSync
+// forming a final unterminated line.
+func splitFormatLines(tokens []Token, opts FormatOptions) []formatLine {
+	var lines []formatLine
+	var cur []Token
+	for _, t := range tokens {
+		cur = append(cur, t)
+		if t.Type == ChannelSync {
+			lines = append(lines, newFormatLine(cur, opts))
+			cur = nil
+		}
+	}
+	if len(cur) > 0 {
+		lines = append(lines, newFormatLine(cur, opts))
+	}
+	return lines
+}
+
+func newFormatLine(tokens []Token, opts FormatOptions) formatLine {
+	texts := make([]string, len(tokens))
+	for i, t := range tokens {
+		texts[i] = canonicalText(t, opts)
+	}
+	return formatLine{
+		tokens:     tokens,
+		texts:      texts,
+		endsInSync: len(tokens) > 0 && tokens[len(tokens)-1].Type == ChannelSync,
+	}
+}
+
+func canonicalText(t Token, opts FormatOptions) string {
+	switch t.Type {
+	case LoopTag:
+		if opts.LowercaseKeywords {
+			return "loop:"
+		}
+		return "LOOP:"
+	case AdsrVector:
+		if len(t.Submatch) < 6 {
+			return t.Content
+		}
+		kw := "ADSR"
+		if opts.LowercaseKeywords {
+			kw = "adsr"
+		}
+		return fmt.Sprintf("%s: %s->%s, %s->%s, %s, %s", kw,
+			t.Submatch[0], t.Submatch[1], t.Submatch[2], t.Submatch[3], t.Submatch[4], t.Submatch[5])
+	default:
+		return t.Content
+	}
+}
+
+// HighlightStyle maps a TokenType to whatever style key the host wants
+// attached to it (a CSS class name, an ANSI escape, a theme token...).
+// TokenTypes absent from the map produce no Span.
+type HighlightStyle map[TokenType]string
+
+// Span is a styled region of source text, identified by the TokenType's
+// entry in the HighlightStyle that produced it.
+type Span struct {
+	Start, End Position
+	Style      string
+}
+
+// Highlight returns the colorized regions for tokens, keyed by TokenType,
+// so editor plugins and web previews can share the exact lexer used by the
+// compiler instead of reimplementing its regexes.
+func Highlight(tokens []Token, style HighlightStyle) []Span {
+	var spans []Span
+	for _, t := range tokens {
+		s, ok := style[t.Type]
+		if !ok {
+			continue
+		}
+		spans = append(spans, Span{
+			Start: Position{Row: t.Row, Col: t.Col},
+			End:   Position{Row: t.Row, Col: t.Col + len(t.Content)},
+			Style: s,
+		})
+	}
+	return spans
+}
@@ -0,0 +1,107 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenizerAll(t *testing.T) {
+	tok := NewTokenizer(strings.NewReader("c4 d4 --\n"))
+	tokens := tok.All()
+
+	wantTypes := []TokenType{Note, Note, ChannelSync}
+	if len(tokens) != len(wantTypes) {
+		t.Fatalf("got %d tokens, want %d: %+v", len(tokens), len(wantTypes), tokens)
+	}
+	for i, want := range wantTypes {
+		if tokens[i].Type != want {
+			t.Errorf("token %d type = %s, want %s", i, tokens[i].Type, want)
+		}
+	}
+}
+
+func TestFormatCanonicalizesKeywordsAndBreaksOnChannelSync(t *testing.T) {
+	tok := NewTokenizer(strings.NewReader("loop: c4 --\nADSR:1->2,3->4,5,6 c4 --\n"))
+	tokens := tok.All()
+
+	var out strings.Builder
+	if err := Format(tokens, &out, FormatOptions{}); err != nil {
+		t.Fatalf("Format returned error: %s", err)
+	}
+
+	got := out.String()
+	if !strings.Contains(got, "LOOP: c4 --\n") {
+		t.Errorf("expected canonical LOOP: keyword followed by a newline after ChannelSync, got %q", got)
+	}
+	if !strings.Contains(got, "ADSR: 1->2, 3->4, 5, 6 c4 --\n") {
+		t.Errorf("expected canonical ADSR: vector rendering, got %q", got)
+	}
+}
+
+func TestFormatLowercasesKeywordsWhenRequested(t *testing.T) {
+	tok := NewTokenizer(strings.NewReader("LOOP: c4 --\n"))
+	tokens := tok.All()
+
+	var out strings.Builder
+	if err := Format(tokens, &out, FormatOptions{LowercaseKeywords: true}); err != nil {
+		t.Fatalf("Format returned error: %s", err)
+	}
+	if got := out.String(); !strings.HasPrefix(got, "loop:") {
+		t.Errorf("expected lowercased loop: keyword, got %q", got)
+	}
+}
+
+// TestFormatAlignsSeparatorsAcrossLines guards the request's "alignment of
+// Separator bars" requirement: the n-th Separator on each line should land
+// in the same output column as the n-th Separator on every other line, even
+// when the tokens preceding it render to different widths.
+func TestFormatAlignsSeparatorsAcrossLines(t *testing.T) {
+	tok := NewTokenizer(strings.NewReader("c4 d4 | e4 f4 --\nc8 | g4 --\n"))
+	tokens := tok.All()
+
+	var out strings.Builder
+	if err := Format(tokens, &out, FormatOptions{}); err != nil {
+		t.Fatalf("Format returned error: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), out.String())
+	}
+	col0 := strings.Index(lines[0], "|")
+	col1 := strings.Index(lines[1], "|")
+	if col0 < 0 || col1 < 0 {
+		t.Fatalf("expected a Separator on both lines, got %q", lines)
+	}
+	if col0 != col1 {
+		t.Errorf("Separator bars not aligned: line 1 at col %d, line 2 at col %d (%q)", col0, col1, lines)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tok := NewTokenizer(strings.NewReader("c4 d4\n"))
+	tokens := tok.All()
+
+	spans := Highlight(tokens, HighlightStyle{Note: "note"})
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans for the 2 Note tokens, got %d: %+v", len(spans), spans)
+	}
+	for _, s := range spans {
+		if s.Style != "note" {
+			t.Errorf("span style = %q, want %q", s.Style, "note")
+		}
+		if s.End.Col <= s.Start.Col {
+			t.Errorf("expected a non-empty span, got %+v", s)
+		}
+	}
+}
+
+func TestHighlightSkipsUnstyledTokenTypes(t *testing.T) {
+	tok := NewTokenizer(strings.NewReader("c4 --\n"))
+	tokens := tok.All()
+
+	spans := Highlight(tokens, HighlightStyle{Note: "note"})
+	if len(spans) != 1 {
+		t.Fatalf("expected only the Note token to produce a span, got %d: %+v", len(spans), spans)
+	}
+}
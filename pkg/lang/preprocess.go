@@ -0,0 +1,129 @@
+package lang
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SymbolTable holds the $name bindings collected while resolving @import
+// directives, keyed by name, so a library of ADSR envelopes, drum patterns
+// or riffs can be shared across files.
+type SymbolTable map[string][]Token
+
+// Preprocessor resolves @import "path" directives against an fs.FS -
+// typically an embed.FS bundled with the binary, or os.DirFS rooted at a
+// library directory - and collects every `$name := ...` binding it finds
+// along the way into a shared SymbolTable.
+type Preprocessor struct {
+	fsys        fs.FS
+	searchPaths []string
+}
+
+// NewPreprocessor builds a Preprocessor that resolves imports relative to
+// fsys. If a direct lookup fails, each of searchPaths is tried in order,
+// joined with the requested import path.
+func NewPreprocessor(fsys fs.FS, searchPaths ...string) *Preprocessor {
+	return &Preprocessor{fsys: fsys, searchPaths: searchPaths}
+}
+
+var assignLineRE = regexp.MustCompile(`^\s*\$(\w+)\s*:=\s*(.*\S)\s*$`)
+
+// Expand resolves entry and every file it transitively @imports into a
+// single source text, with each "@import \"path\"" line replaced by the
+// (recursively expanded) contents of its target, and returns the
+// SymbolTable of $name := ... bindings found along the way. An @import
+// cycle is reported as an error instead of recursing forever.
+func (p *Preprocessor) Expand(entry string) (string, SymbolTable, error) {
+	symbols := SymbolTable{}
+	visiting := map[string]bool{}
+
+	var expand func(path string) (string, error)
+	expand = func(importPath string) (string, error) {
+		if visiting[importPath] {
+			return "", fmt.Errorf("import cycle detected: %q imports itself transitively", importPath)
+		}
+		visiting[importPath] = true
+		defer delete(visiting, importPath)
+
+		src, err := p.read(importPath)
+		if err != nil {
+			return "", err
+		}
+
+		var out strings.Builder
+		for _, line := range strings.Split(src, "\n") {
+			// Tokenizer reads line-by-line on '\n' and discards whatever it
+			// has buffered when a read hits EOF without one, so an
+			// unterminated line (every line here, since strings.Split
+			// already stripped the separator) would tokenize to nothing.
+			tok := NewTokenizer(strings.NewReader(line + "\n"))
+			if tok.Next() {
+				if t := tok.Get(); t.Type == Include {
+					included, err := expand(t.getImportPath())
+					if err != nil {
+						return "", fmt.Errorf("%s: %w", importPath, err)
+					}
+					out.WriteString(included)
+					out.WriteString("\n")
+					continue
+				}
+			}
+			if m := assignLineRE.FindStringSubmatch(line); m != nil {
+				symbols[m[1]] = tokenize(m[2])
+			}
+			out.WriteString(line)
+			out.WriteString("\n")
+		}
+		return out.String(), nil
+	}
+
+	src, err := expand(entry)
+	if err != nil {
+		return "", nil, err
+	}
+	return src, symbols, nil
+}
+
+// tokenize runs s through a plain Tokenizer and collects every Token it
+// produces, for capturing the right-hand side of a $name := ... binding. s
+// is a line fragment with no trailing newline, so one is added for the same
+// reason Expand adds one before tokenizing a line.
+func tokenize(s string) []Token {
+	tok := NewTokenizer(strings.NewReader(s + "\n"))
+	var tokens []Token
+	for tok.Next() {
+		tokens = append(tokens, tok.Get())
+	}
+	return tokens
+}
+
+func (p *Preprocessor) read(importPath string) (string, error) {
+	if b, err := fs.ReadFile(p.fsys, importPath); err == nil {
+		return string(b), nil
+	}
+	for _, dir := range p.searchPaths {
+		if b, err := fs.ReadFile(p.fsys, path.Join(dir, importPath)); err == nil {
+			return string(b), nil
+		}
+	}
+	return "", fmt.Errorf("can't resolve import %q", importPath)
+}
+
+// NewTokenizerFS builds a Tokenizer over entry, after resolving every
+// @import "path" directive it transitively references against fsys, and
+// returns the SymbolTable of $name := ... bindings collected across entry
+// and everything it imports. This lets hosts supply an embed.FS bundled at
+// compile time, or an on-disk fs.FS rooted at a library directory, instead
+// of a single io.Reader, and gives a downstream parser a way to resolve
+// those shared bindings instead of only getting the textually-inlined
+// source.
+func NewTokenizerFS(fsys fs.FS, entry string) (*Tokenizer, SymbolTable, error) {
+	src, symbols, err := NewPreprocessor(fsys).Expand(entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewTokenizer(strings.NewReader(src)), symbols, nil
+}
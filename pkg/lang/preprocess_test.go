@@ -0,0 +1,65 @@
+package lang
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExpandInlinesImportsAndCollectsSymbols(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/drums.mml": {Data: []byte("$kick := c4\n")},
+		"song.mml":      {Data: []byte("@import \"lib/drums.mml\"\n$tempo := t120\nc4 d4\n")},
+	}
+
+	src, symbols, err := NewPreprocessor(fsys).Expand("song.mml")
+	if err != nil {
+		t.Fatalf("Expand returned error: %s", err)
+	}
+	if !strings.Contains(src, "c4 d4") {
+		t.Errorf("expected entry file content preserved, got:\n%s", src)
+	}
+	if _, ok := symbols["kick"]; !ok {
+		t.Error("expected $kick binding from the imported file in the symbol table")
+	}
+	if _, ok := symbols["tempo"]; !ok {
+		t.Error("expected $tempo binding from the entry file in the symbol table")
+	}
+}
+
+func TestExpandDetectsImportCycle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.mml": {Data: []byte("@import \"b.mml\"\n")},
+		"b.mml": {Data: []byte("@import \"a.mml\"\n")},
+	}
+	if _, _, err := NewPreprocessor(fsys).Expand("a.mml"); err == nil {
+		t.Fatal("expected an import cycle error")
+	}
+}
+
+func TestExpandResolvesImportsViaSearchPaths(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/riff.mml": {Data: []byte("e4\n")},
+		"song.mml":     {Data: []byte("@import \"riff.mml\"\n")},
+	}
+	src, _, err := NewPreprocessor(fsys, "lib").Expand("song.mml")
+	if err != nil {
+		t.Fatalf("Expand returned error: %s", err)
+	}
+	if !strings.Contains(src, "e4") {
+		t.Errorf("expected riff.mml resolved via searchPaths, got:\n%s", src)
+	}
+}
+
+func TestNewTokenizerFSReturnsSymbolTable(t *testing.T) {
+	fsys := fstest.MapFS{
+		"song.mml": {Data: []byte("$tempo := t120\nc4\n")},
+	}
+	_, symbols, err := NewTokenizerFS(fsys, "song.mml")
+	if err != nil {
+		t.Fatalf("NewTokenizerFS returned error: %s", err)
+	}
+	if _, ok := symbols["tempo"]; !ok {
+		t.Error("expected NewTokenizerFS to surface the SymbolTable collected while expanding imports")
+	}
+}
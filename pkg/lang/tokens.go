@@ -35,6 +35,7 @@ const (
 	Number      TokenType = "Number"
 	ChannelId   TokenType = "ChannelId"
 	SendArrow   TokenType = "SendArrow"
+	Include     TokenType = "Include"
 )
 
 var tokenDefs = []struct {
@@ -52,6 +53,8 @@ var tokenDefs = []struct {
 	{t: Separator, r: regexp.MustCompile(`^\|+$`)},
 	{t: ConstName, r: regexp.MustCompile(`^\$(\w+)$`)},
 	{t: Assign, r: regexp.MustCompile(`^:=$`)},
+	// Must come before ChannelId, which would otherwise swallow the leading "@import".
+	{t: Include, r: regexp.MustCompile(`^@import\s+"([^"]+)"$`)},
 	{t: ChannelId, r: regexp.MustCompile(`^@(\w+)$`)},
 	{t: ChannelSync, r: regexp.MustCompile(`^-{2,}$`)},
 	// Tablature stuff needs to go at the bottom, to not get confusion with other language grammar items
@@ -67,8 +70,10 @@ type Tokenizer struct {
 	col       int
 	input     *bufio.Reader
 	lineRest  string //line that is being currently parsed
+	fullLine  string // full text of the line currently being parsed, for diagnostic rendering
 	lastMatch string
 	tokens    *regexp.Regexp
+	sink      DiagnosticSink
 }
 
 func NewTokenizer(input io.Reader) *Tokenizer {
@@ -87,6 +92,13 @@ func NewTokenizer(input io.Reader) *Tokenizer {
 	}
 }
 
+// Errors returns all the Diagnostics accumulated while tokenizing the input
+// so far. It is safe to call before tokenizing finishes, to report progress
+// on a long input, or after EOF to get the final batch.
+func (t *Tokenizer) Errors() []Diagnostic {
+	return t.sink.Diagnostics()
+}
+
 func (t *Tokenizer) Next() bool {
 	t.col += len(t.lastMatch)
 	for !t.EOF() {
@@ -120,6 +132,7 @@ func (t *Tokenizer) readMoreLines() {
 		}
 		panic(fmt.Errorf("can't read next line: %w", err))
 	}
+	t.fullLine = strings.TrimRight(t.lineRest, "\r\n")
 	t.col = 1
 	t.row++
 }
@@ -132,6 +145,17 @@ func (t *Tokenizer) Get() Token {
 	return t.parseToken(t.lastMatch)
 }
 
+// All drains the Tokenizer and returns every Token it produces, in order.
+// It is meant for tooling (formatters, highlighters) that need the whole
+// stream at once rather than the incremental Next/Get loop a parser uses.
+func (t *Tokenizer) All() []Token {
+	var tokens []Token
+	for t.Next() {
+		tokens = append(tokens, t.Get())
+	}
+	return tokens
+}
+
 type Token struct {
 	Type TokenType
 	// TODO: replace content[0] invocations by typesafe functions
@@ -139,16 +163,24 @@ type Token struct {
 	// TODO: replace inline indexing by typesafe functions
 	Submatch []string
 	Row, Col int
+	// Line is the full source line the token was read from, kept around so
+	// that diagnostics raised from this token can render a caret.
+	Line string
+	// sink collects diagnostics for malformed values carried by this token
+	// (e.g. a number too large to fit an int). May be nil for tokens built
+	// outside of a Tokenizer, in which case such errors are silently
+	// defaulted instead of reported.
+	sink *DiagnosticSink
 }
 
 func (t *Tokenizer) parseToken(token string) Token {
 	for _, td := range tokenDefs {
 		submatches := td.r.FindStringSubmatch(token)
 		if submatches != nil {
-			return Token{Type: td.t, Content: token, Submatch: submatches[1:], Row: t.row, Col: t.col}
+			return Token{Type: td.t, Content: token, Submatch: submatches[1:], Row: t.row, Col: t.col, Line: t.fullLine, sink: &t.sink}
 		}
 	}
-	return Token{Type: AnyString, Content: token, Row: t.row, Col: t.col}
+	return Token{Type: AnyString, Content: token, Row: t.row, Col: t.col, Line: t.fullLine, sink: &t.sink}
 }
 
 func (f *Token) assertType(expected TokenType) {
@@ -164,17 +196,36 @@ func (f *Token) getConstID() string {
 
 func (f *Token) getTupletNumber() int {
 	f.assertType(CloseTuple)
-	return mustAtoi(f.Submatch[0])
+	return f.atoi(f.Submatch[0])
 }
 
-func mustAtoi(num string) int {
-	n, err := strconv.Atoi(num)
+// atoi parses a decimal number carried by this token (e.g. a note length or
+// a tuplet count). Since these come straight from user input, a value that
+// doesn't fit an int is reported as a Diagnostic instead of panicking; 0 is
+// returned so that tokenizing can keep going and report further problems.
+func (f *Token) atoi(raw string) int {
+	n, err := strconv.Atoi(raw)
 	if err != nil {
-		panic(fmt.Sprintf("BUG detected. Expected number, got %q", num))
+		f.errorf("invalid number %q in %q: %s", raw, f.Content, err.Error())
+		return 0
 	}
 	return n
 }
 
+// errorf raises an error-severity Diagnostic spanning this token, for
+// malformed values carried by user input. It is a no-op if the token
+// wasn't produced by a Tokenizer (sink is nil).
+func (f *Token) errorf(format string, args ...any) {
+	if f.sink == nil {
+		return
+	}
+	f.sink.Errorf(
+		Position{Row: f.Row, Col: f.Col},
+		Position{Row: f.Row, Col: f.Col + len(f.Content)},
+		f.Line,
+		format, args...)
+}
+
 func (f *Token) getOctaveStep() int {
 	f.assertType(OctaveStep)
 	switch f.Content[0] {
@@ -183,7 +234,7 @@ func (f *Token) getOctaveStep() int {
 	case '>':
 		return +1
 	default:
-		panic(fmt.Sprintf("BUG detected. Invalid octave step %q", t.Content))
+		panic(fmt.Sprintf("BUG detected. Invalid octave step %q", f.Content))
 	}
 }
 
@@ -225,14 +276,11 @@ func (f *Token) getNote() (note.Note, error) {
 
 	// get Length
 	if len(f.Submatch[2]) > 0 {
-		l, err := strconv.Atoi(f.Submatch[2])
-		if err != nil {
-			panic(fmt.Sprintf("BUG detected. Wrong length for note: %#v. Err: %s",
-				f, err.Error()))
-		}
+		l := f.atoi(f.Submatch[2])
 		if l < minLength || l > maxLength {
-			return n, fmt.Errorf(
-				"wrong note length: %d. Must be in range %d to %d", l, minLength, maxLength)
+			err := fmt.Errorf("wrong note length: %d. Must be in range %d to %d", l, minLength, maxLength)
+			f.errorf("%s", err.Error())
+			return n, err
 		}
 		n.Length = l
 	}
@@ -241,7 +289,7 @@ func (f *Token) getNote() (note.Note, error) {
 
 func (token *Token) getOctave() int {
 	token.assertType(Octave)
-	return mustAtoi(token.Submatch[0])
+	return token.atoi(token.Submatch[0])
 }
 
 func (token *Token) getSilence() note.Note {
@@ -251,19 +299,19 @@ func (token *Token) getSilence() note.Note {
 		n.Length = defaultLength
 		return n
 	}
-	n.Length = mustAtoi(token.Submatch[0])
+	n.Length = token.atoi(token.Submatch[0])
 	return n
 }
 
 func (tok *Token) getAdsr() []song.TimePoint {
 	tok.assertType(AdsrVector)
-	attackLevel := float64(mustAtoi(tok.Submatch[1])) / 100.0
-	decayLevel := float64(mustAtoi(tok.Submatch[3])) / 100.0
+	attackLevel := float64(tok.atoi(tok.Submatch[1])) / 100.0
+	decayLevel := float64(tok.atoi(tok.Submatch[3])) / 100.0
 	return []song.TimePoint{
-		{Time: time.Duration(mustAtoi(tok.Submatch[0])) * time.Millisecond, Val: attackLevel},
-		{Time: time.Duration(mustAtoi(tok.Submatch[2])) * time.Millisecond, Val: decayLevel},
-		{Time: time.Duration(mustAtoi(tok.Submatch[4])) * time.Millisecond, Val: decayLevel},
-		{Time: time.Duration(mustAtoi(tok.Submatch[5])) * time.Millisecond, Val: 0},
+		{Time: time.Duration(tok.atoi(tok.Submatch[0])) * time.Millisecond, Val: attackLevel},
+		{Time: time.Duration(tok.atoi(tok.Submatch[2])) * time.Millisecond, Val: decayLevel},
+		{Time: time.Duration(tok.atoi(tok.Submatch[4])) * time.Millisecond, Val: decayLevel},
+		{Time: time.Duration(tok.atoi(tok.Submatch[5])) * time.Millisecond, Val: 0},
 	}
 }
 
@@ -282,3 +330,8 @@ func (t *Token) getChannelId() string {
 	t.assertType(ChannelId)
 	return t.Submatch[0]
 }
+
+func (t *Token) getImportPath() string {
+	t.assertType(Include)
+	return t.Submatch[0]
+}
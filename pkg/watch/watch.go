@@ -0,0 +1,137 @@
+// Package watch implements a "save and hear" workflow: it watches an MML
+// source file for changes, recompiles it on every write, and hands the
+// recompiled song.Song to a Swapper at the next bar boundary rather than
+// mid-bar. The Watcher has no visibility into playback position itself, so
+// it relies on the player to call BarBoundary whenever playback reaches
+// one; a compiled song sits in the Watcher as pending until that happens.
+package watch
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/mariomac/msxmml/pkg/lang"
+	"github.com/mariomac/msxmml/pkg/song"
+)
+
+// Swapper is implemented by whatever is currently rendering audio.
+// SwapSong is called only from BarBoundary, never directly from a reload,
+// so a swap never lands mid-bar.
+type Swapper interface {
+	SwapSong(s *song.Song)
+}
+
+// Watcher recompiles a single MML file every time it changes on disk, and
+// hands the result to its Swapper at the next bar boundary.
+type Watcher struct {
+	path     string
+	fsw      *fsnotify.Watcher
+	player   Swapper
+	OnErrors func(diags []lang.Diagnostic)
+
+	mu      sync.Mutex
+	pending *song.Song
+}
+
+// New opens path and starts watching it for writes. The caller must call
+// Close when done.
+func New(path string, player Swapper) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating file watcher: %w", err)
+	}
+	if err := fsw.Add(path); err != nil {
+		fsw.Close()
+		return nil, fmt.Errorf("watching %s: %w", path, err)
+	}
+	return &Watcher{path: path, fsw: fsw, player: player}, nil
+}
+
+// Close stops watching the file.
+func (w *Watcher) Close() error {
+	return w.fsw.Close()
+}
+
+// Run blocks, recompiling the source on every write or create event it
+// receives, until the underlying fsnotify.Watcher is closed, or returns the
+// first error the fsnotify.Watcher reports.
+func (w *Watcher) Run() error {
+	w.reload()
+	// Nothing is playing yet, so there's no bar to land on - swap the first
+	// compile in immediately instead of leaving the player silent until it
+	// next calls BarBoundary.
+	w.BarBoundary()
+
+	for {
+		select {
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+				w.reload()
+			}
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("watching %s: %w", w.path, err)
+		}
+	}
+}
+
+// BarBoundary must be called by the player whenever its playback position
+// crosses a bar line (detected via ChannelSync tokens or measure count). If
+// a recompile is pending, it is handed to the Swapper now, so the file's
+// last saved state takes over exactly on the bar line instead of wherever
+// the player happened to be when the file was saved.
+func (w *Watcher) BarBoundary() {
+	w.mu.Lock()
+	s := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	if s != nil {
+		w.player.SwapSong(s)
+	}
+}
+
+// reload recompiles the watched file and, if it parses cleanly, stores it as
+// pending for the next BarBoundary call - see BarBoundary for why the swap
+// itself is deferred. Diagnostics from a failed compile are reported via
+// OnErrors rather than aborting the watch loop, so a typo mid-edit doesn't
+// kill the session.
+func (w *Watcher) reload() {
+	f, err := os.Open(w.path)
+	if err != nil {
+		if w.OnErrors != nil {
+			w.OnErrors([]lang.Diagnostic{{Severity: lang.SeverityError, Message: err.Error()}})
+		}
+		return
+	}
+	defer f.Close()
+
+	tok := lang.NewTokenizer(f)
+	s, err := song.Compile(tok)
+	diags := tok.Errors()
+	if len(diags) > 0 && w.OnErrors != nil {
+		w.OnErrors(diags)
+	}
+	// A lone warning shouldn't block the swap; only bail out on actual errors.
+	if lang.HasErrors(diags) {
+		return
+	}
+	if err != nil {
+		if w.OnErrors != nil {
+			w.OnErrors([]lang.Diagnostic{{Severity: lang.SeverityError, Message: err.Error()}})
+		}
+		return
+	}
+
+	w.mu.Lock()
+	w.pending = s
+	w.mu.Unlock()
+}
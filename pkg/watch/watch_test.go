@@ -0,0 +1,75 @@
+package watch
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mariomac/msxmml/pkg/lang"
+	"github.com/mariomac/msxmml/pkg/song"
+)
+
+type fakeSwapper struct {
+	swapped *song.Song
+}
+
+func (f *fakeSwapper) SwapSong(s *song.Song) {
+	f.swapped = s
+}
+
+func TestReloadReportsErrorAndDoesNotSwapOnOpenFailure(t *testing.T) {
+	player := &fakeSwapper{}
+	w := &Watcher{path: "/nonexistent/path/to/song.mml", player: player}
+
+	var diags []lang.Diagnostic
+	w.OnErrors = func(d []lang.Diagnostic) { diags = d }
+
+	w.reload()
+
+	if player.swapped != nil {
+		t.Fatal("expected SwapSong not to be called when the watched file can't be opened")
+	}
+	if len(diags) == 0 {
+		t.Fatal("expected OnErrors to be invoked when the watched file can't be opened")
+	}
+	if !lang.HasErrors(diags) {
+		t.Error("expected the open failure to be reported as an error-severity diagnostic")
+	}
+}
+
+// TestReloadDefersSwapUntilBarBoundary guards the reason BarBoundary exists:
+// a successful recompile must not reach the player until the player itself
+// says playback has crossed a bar line, or a live edit could swap the song
+// mid-bar and produce an audible glitch.
+func TestReloadDefersSwapUntilBarBoundary(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/song.mml"
+	if err := os.WriteFile(path, []byte("c4\n"), 0o644); err != nil {
+		t.Fatalf("writing fixture file: %s", err)
+	}
+
+	player := &fakeSwapper{}
+	w := &Watcher{path: path, player: player}
+
+	w.reload()
+	if player.swapped != nil {
+		t.Fatal("expected reload alone not to call SwapSong before a bar boundary")
+	}
+
+	w.BarBoundary()
+	if player.swapped == nil {
+		t.Fatal("expected BarBoundary to flush the pending recompile to SwapSong")
+	}
+}
+
+// TestBarBoundaryIsANoOpWithNothingPending guards against BarBoundary
+// calling SwapSong(nil) when no recompile is waiting - e.g. two bar
+// boundaries passing between saves.
+func TestBarBoundaryIsANoOpWithNothingPending(t *testing.T) {
+	player := &fakeSwapper{}
+	w := &Watcher{player: player}
+
+	w.BarBoundary()
+	if player.swapped != nil {
+		t.Fatal("expected BarBoundary to do nothing when no recompile is pending")
+	}
+}